@@ -0,0 +1,110 @@
+package zerodown
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variable pointing the child process at the file descriptor
+// holding its validated config blob, see SetConfig and ReadConfig
+const configEnvVar = "ZERODOWN_CONFIG_FD"
+
+// ConfigLoader loads configuration, typically by reading one or more files
+// from disk, and returns it as an opaque value for ConfigValidator to check
+type ConfigLoader func() (config any, err error)
+
+// ConfigValidator validates a configuration value previously returned by a
+// ConfigLoader, returning an error if the config shouldn't be used
+type ConfigValidator func(config any) error
+
+var (
+	configLoader    ConfigLoader
+	configValidator ConfigValidator
+)
+
+// SetConfig registers the loader and validator used for SIGHUP-triggered
+// config reloads. When a reload signal is caught, the parent process calls
+// loader and validator itself, before forking a new child, and only
+// restarts if validation succeeds; otherwise it logs the error and keeps the
+// current child running. This avoids the TOCTOU problem of starting a new
+// child against a config file that has changed (or broken) between the
+// parent validating it and the child reading it itself: the validated
+// config is instead passed down to the child through a pipe, see ReadConfig
+func SetConfig(loader ConfigLoader, validator ConfigValidator) {
+	configLoader = loader
+	configValidator = validator
+}
+
+// loadConfig runs the registered ConfigLoader and ConfigValidator, if any.
+// ok is false if no ConfigLoader was registered, in which case restart()
+// proceeds without passing a config down to the child
+func loadConfig() (config any, ok bool, err error) {
+	if configLoader == nil {
+		return nil, false, nil
+	}
+
+	config, err = configLoader()
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if configValidator != nil {
+		if err = configValidator(config); err != nil {
+			return nil, true, fmt.Errorf("config validation failed: %w", err)
+		}
+	}
+
+	return config, true, nil
+}
+
+// configPipe marshals config to JSON and writes it into a pipe, returning
+// the read end (to be added to cmd.ExtraFiles) and the ZERODOWN_CONFIG_FD
+// environment assignment pointing the child at it. baseFD is the file
+// descriptor number the read end will end up on in the child process. The
+// write end is closed automatically once the write finishes
+func configPipe(config any, baseFD int) (read *os.File, env string, err error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	read, write, err := os.Pipe()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create config pipe: %w", err)
+	}
+
+	go func() {
+		defer write.Close()
+		write.Write(data)
+	}()
+
+	return read, configEnvVar + "=" + strconv.Itoa(baseFD), nil
+}
+
+// ReadConfig reads and JSON-decodes the config blob the parent process
+// loaded, validated and passed down through ZERODOWN_CONFIG_FD into v. ok is
+// false if no config was passed down (SetConfig was never called, or this is
+// the first child process, started before any config reload), in which case
+// the caller should fall back to loading its own config from disk
+func ReadConfig(v any) (ok bool, err error) {
+	raw := os.Getenv(configEnvVar)
+	if raw == "" {
+		return false, nil
+	}
+
+	fd, err := strconv.Atoi(raw)
+	if err != nil {
+		return false, fmt.Errorf("zerodown: invalid %s value %q: %w", configEnvVar, raw, err)
+	}
+
+	var file = os.NewFile(uintptr(fd), "zerodown-config")
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(v); err != nil {
+		return false, fmt.Errorf("zerodown: failed to decode config: %w", err)
+	}
+
+	return true, nil
+}
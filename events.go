@@ -0,0 +1,132 @@
+package zerodown
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is implemented by every lifecycle event emitted through Events() and
+// OnEvent. Use a type switch on the concrete type to handle individual
+// events.
+//
+// These events are only ever emitted by the parent process, since it's the
+// one running the restart loop they describe. Register Events()/OnEvent
+// before calling zerodown.Init(); a child process calling Restart() never
+// sees its own request show up here, since Init() only returns in the child
+type Event interface {
+	// eventMarker is unexported so only this package can implement Event
+	eventMarker()
+}
+
+// ChildStarted is emitted right after a new child process has been started,
+// before we know whether it will finish initializing successfully
+type ChildStarted struct {
+	PID     int
+	Attempt int
+}
+
+// ChildReady is emitted once a child process has confirmed it's ready to
+// take over, either by calling StartupFinished() or through a ReadinessProbe.
+// It is also emitted, right after StartupTimedOut, when StartupTimeout is
+// reached first, since the child is then taken into service anyway
+type ChildReady struct {
+	PID      int
+	Duration time.Duration
+}
+
+// ChildExited is emitted whenever a child process exits, whether it was
+// asked to stop or crashed on its own
+type ChildExited struct {
+	PID   int
+	State *os.ProcessState
+	Err   error
+
+	// Expected is true if this process was deliberately retired through
+	// stopChild (e.g. the previous process after a successful handoff, or
+	// the current one during final shutdown), and false if it exited on its
+	// own. State.Success() and Err are not reliable ways to tell these apart
+	// on their own: stopChild signals SIGINT by default, so even an expected
+	// exit normally reports a non-nil Err and State.Success() == false
+	Expected bool
+}
+
+// RestartRequested is emitted whenever restart() is about to be called,
+// before the new child process is started
+type RestartRequested struct {
+	// Source describes what triggered the restart. Currently always
+	// "signal", since RestartRequested is only ever emitted by the parent
+	// process in response to a reload signal (see Event)
+	Source string
+}
+
+// SignalReceived is emitted for every signal zerodown catches, regardless of
+// what it does with it
+type SignalReceived struct {
+	Signal os.Signal
+}
+
+// StartupTimedOut is emitted when StartupTimeout is reached before a child
+// process reported it was ready
+type StartupTimedOut struct {
+	PID int
+}
+
+func (ChildStarted) eventMarker()     {}
+func (ChildReady) eventMarker()       {}
+func (ChildExited) eventMarker()      {}
+func (RestartRequested) eventMarker() {}
+func (SignalReceived) eventMarker()   {}
+func (StartupTimedOut) eventMarker()  {}
+
+var (
+	eventMu        sync.Mutex
+	eventChan      chan Event
+	eventListeners []func(Event)
+)
+
+// Events returns a channel that receives every lifecycle event zerodown
+// emits. The channel is created, and starts filling, on first call. It's
+// buffered; if the receiver falls behind, new events are dropped (and
+// logged) rather than blocking zerodown's internal goroutines
+func Events() <-chan Event {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+
+	if eventChan == nil {
+		eventChan = make(chan Event, 64)
+	}
+
+	return eventChan
+}
+
+// OnEvent registers fn to be called for every lifecycle event zerodown
+// emits, in addition to (or instead of) reading from Events(). fn is called
+// synchronously from zerodown's internal goroutines, so it must not block
+func OnEvent(fn func(Event)) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+
+	eventListeners = append(eventListeners, fn)
+}
+
+// emit delivers ev to the Events() channel, if anyone ever asked for one,
+// and to every OnEvent listener
+func emit(ev Event) {
+	eventMu.Lock()
+	var ch = eventChan
+	var listeners = eventListeners
+	eventMu.Unlock()
+
+	if ch != nil {
+		select {
+		case ch <- ev:
+		default:
+			print("Event channel is full, dropping %T event", ev)
+		}
+	}
+
+	for _, fn := range listeners {
+		fn(ev)
+	}
+}
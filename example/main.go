@@ -1,16 +1,14 @@
 package main
 
 import (
-	"context"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
-	"os/signal"
 	"syscall"
 	"time"
 
 	"fornaxian.tech/zerodown"
+	"fornaxian.tech/zerodown/zdhttp"
 )
 
 // This example starts a HTTP server on port 8080. The server returns a slow
@@ -22,47 +20,43 @@ import (
 //
 //	systemd-socket-activate --listen=8080 ./main
 //
-// The server will be started on the first request. The listener is passed down
-// to the child process with ExtraFiles
+// The listener is opened once in the parent process with zerodown.ListenTCP,
+// which transparently keeps reusing the same file descriptor across restarts
+// (and across systemd socket activations), so the child never has to know
+// whether it's looking at a freshly opened socket or an inherited one
 func main() {
-	// If this is the parent process we create the listener and pass it through
-	// to the child. If we have a systemd socket, as indicated by LISTEN_FDS, we
-	// don't need to open the listener ourselves. Systemd will automatically
-	// pass the socket file down to all child processes
 	if os.Getenv("LISTEN_FDS") != "" {
-		fmt.Println("We received a socket from systemd")
-
 		// Sighup doesn't work with systemd-socket-activate for some reason.
 		// systemd itself catches the hangup signal and doesn't pass it down.
 		// Using a different signal works
 		zerodown.ReloadSignals = []os.Signal{syscall.SIGUSR2}
+	}
 
-	} else if zerodown.IsParent() {
-		listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: 8080})
-		panicOnErr(err)
-
-		file, err := listener.File()
+	if zerodown.IsParent() {
+		_, err := zerodown.ListenTCP(":8080")
 		panicOnErr(err)
-
-		zerodown.ExtraFiles = []*os.File{file}
 	}
 
 	if zerodown.Init() {
 		return
 	}
 
-	// Get the socket from the parent process and start a server with it
-	listener, err := net.FileListener(os.NewFile(3, "MyListener"))
+	// Look up the listener again. Whether it was just opened by the parent,
+	// inherited from a previous incarnation of this process, or handed to us
+	// by systemd, this returns the same listener
+	listener, err := zerodown.ListenTCP(":8080")
 	panicOnErr(err)
 
-	var server = exampleServer(listener)
+	var server = exampleServer()
 
 	zerodown.StartupFinished()
 
-	stopOnSignal(server)
+	// Serve blocks until zerodown asks us to stop, then drains in-flight
+	// requests for up to 30 seconds before returning
+	panicOnErr(zdhttp.Serve(server, listener, time.Second*30))
 }
 
-func exampleServer(l net.Listener) (server *http.Server) {
+func exampleServer() (server *http.Server) {
 	var mux = http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "Hello")
@@ -99,27 +93,10 @@ func exampleServer(l net.Listener) (server *http.Server) {
 		}
 	})
 	server = &http.Server{Handler: mux}
-	go server.Serve(l)
 
-	fmt.Println("Started HTTP server")
 	return server
 }
 
-func stopOnSignal(server *http.Server) {
-	var signals = make(chan os.Signal, 1)
-	signal.Notify(signals, zerodown.StopSignals...)
-
-	fmt.Printf("Caught signal %s, stopping HTTP server\n", <-signals)
-
-	var ctx, cancel = context.WithTimeout(context.Background(), time.Hour*48)
-	if err := server.Shutdown(ctx); err != nil {
-		panic(fmt.Errorf("graceful shutdown failed: %w", err))
-	}
-	cancel()
-
-	fmt.Println("HTTP server stopped")
-}
-
 func panicOnErr(err error) {
 	if err != nil {
 		panic(err)
@@ -0,0 +1,307 @@
+package zerodown
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment variable used to tell the child process which file descriptors
+// hold the listeners opened by the parent process, and which network/address
+// each one belongs to. The format is a comma separated list of
+// "network://address=fd" entries, e.g.
+// "tcp://:8080=3,unix:///run/foo.sock=4"
+const listenersEnvVar = "ZERODOWN_LISTENERS"
+
+// firstExtraFD is the file descriptor number of the first entry in
+// cmd.ExtraFiles. File descriptors 0, 1 and 2 are reserved for
+// stdin/stdout/stderr
+const firstExtraFD = 3
+
+// systemdFirstFD is the file descriptor number of the first socket passed
+// down by systemd through the LISTEN_FDS socket activation protocol
+const systemdFirstFD = 3
+
+var (
+	listenersMu sync.Mutex
+
+	// listeners holds the listeners opened by Listen, ListenTCP, ListenUnix
+	// and ListenPacket in this process, keyed by "network://address". These
+	// are duplicated into the child process's ExtraFiles on restart() so the
+	// sockets survive the restart without dropping connections
+	listeners = map[string]*os.File{}
+
+	// systemdOnce guards the one-time parsing of the LISTEN_FDS environment
+	// passed down by systemd
+	systemdOnce sync.Once
+
+	// systemdNamed holds systemd sockets that were given an explicit name via
+	// FileDescriptorName= in the systemd socket unit, keyed by that name. We
+	// expect the name to be set to the same "network://address" key used
+	// everywhere else so it can be looked up by Listen
+	systemdNamed = map[string]*os.File{}
+
+	// systemdUnnamed holds systemd sockets without a usable name, in the
+	// order they were received. They are handed out in that order to
+	// whichever Listen call asks first
+	systemdUnnamed []*os.File
+)
+
+// fileConn is implemented by net.TCPListener, net.UnixListener, net.UDPConn
+// and net.UnixConn, and lets us duplicate the underlying file descriptor so
+// it can be passed down to the child process
+type fileConn interface {
+	File() (*os.File, error)
+}
+
+func listenerKey(network, address string) string {
+	return network + "://" + address
+}
+
+// Listen announces a listener on the local network address, just like
+// net.Listen. Unlike net.Listen, it first checks whether a listener for this
+// exact network/address was already opened by a previous incarnation of this
+// process (handed down through restart()) or by systemd through socket
+// activation, and if so reuses that file descriptor instead of opening a new
+// socket. This makes zero-downtime restarts and systemd socket activation
+// transparent: replace net.Listen with zerodown.Listen and the rest of the
+// ExtraFiles/os.NewFile dance is handled for you. Only listeners opened in
+// the parent process, before zerodown.Init(), are handed down to child
+// processes; a listener opened only in a child process is not passed on.
+func Listen(network, address string) (net.Listener, error) {
+	if file, ok := inheritedFile(network, address); ok {
+		storeInheritedFile(network, address, file)
+		return net.FileListener(file)
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registerListener(network, address, listener); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// ListenTCP is like Listen, but returns a *net.TCPListener so callers don't
+// need to type-assert the result
+func ListenTCP(address string) (*net.TCPListener, error) {
+	listener, err := Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("zerodown: inherited listener for %s is not a TCP listener", address)
+	}
+
+	return tcpListener, nil
+}
+
+// ListenUnix is like Listen, but returns a *net.UnixListener so callers don't
+// need to type-assert the result
+func ListenUnix(address string) (*net.UnixListener, error) {
+	listener, err := Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+
+	unixListener, ok := listener.(*net.UnixListener)
+	if !ok {
+		return nil, fmt.Errorf("zerodown: inherited listener for %s is not a Unix listener", address)
+	}
+
+	return unixListener, nil
+}
+
+// ListenPacket announces a packet connection (e.g. "udp" or "unixgram"), just
+// like net.ListenPacket. Like Listen, it transparently reuses a connection
+// inherited from a previous incarnation of this process or from systemd
+// socket activation if one is available
+func ListenPacket(network, address string) (net.PacketConn, error) {
+	if file, ok := inheritedFile(network, address); ok {
+		storeInheritedFile(network, address, file)
+		return net.FilePacketConn(file)
+	}
+
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	fc, ok := conn.(fileConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("zerodown: connection for %s does not support duplicating its file descriptor", listenerKey(network, address))
+	}
+
+	if err := storeListenerFile(network, address, fc); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// registerListener duplicates the file descriptor backing listener and
+// stores it so it can be handed down to the child process on restart()
+func registerListener(network, address string, listener net.Listener) error {
+	fc, ok := listener.(fileConn)
+	if !ok {
+		return fmt.Errorf("zerodown: listener for %s does not support duplicating its file descriptor", listenerKey(network, address))
+	}
+
+	return storeListenerFile(network, address, fc)
+}
+
+func storeListenerFile(network, address string, fc fileConn) error {
+	var key = listenerKey(network, address)
+
+	file, err := fc.File()
+	if err != nil {
+		return fmt.Errorf("zerodown: failed to duplicate file descriptor for %s: %w", key, err)
+	}
+
+	listenersMu.Lock()
+	listeners[key] = file
+	listenersMu.Unlock()
+
+	return nil
+}
+
+// storeInheritedFile records a file we received through ZERODOWN_LISTENERS
+// or systemd socket activation under its network/address key, the same way
+// storeListenerFile does for freshly opened listeners. Without this, a
+// listener this process only ever inherited (never opened itself) would be
+// missing from listenerExtraFiles, and the next child we start wouldn't get
+// it handed down at all
+func storeInheritedFile(network, address string, file *os.File) {
+	var key = listenerKey(network, address)
+
+	listenersMu.Lock()
+	listeners[key] = file
+	listenersMu.Unlock()
+}
+
+// inheritedFile looks up a file descriptor for network/address that was
+// either passed down by the parent process through the ZERODOWN_LISTENERS
+// environment variable, or received from systemd through socket activation
+func inheritedFile(network, address string) (*os.File, bool) {
+	var key = listenerKey(network, address)
+
+	if fd, ok := parseListenersEnv()[key]; ok {
+		return os.NewFile(uintptr(fd), key), true
+	}
+
+	systemdOnce.Do(loadSystemdListeners)
+
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	if file, ok := systemdNamed[key]; ok {
+		return file, true
+	}
+
+	if len(systemdUnnamed) > 0 {
+		var file = systemdUnnamed[0]
+		systemdUnnamed = systemdUnnamed[1:]
+		return file, true
+	}
+
+	return nil, false
+}
+
+// parseListenersEnv parses the ZERODOWN_LISTENERS environment variable into
+// a map of "network://address" to file descriptor number
+func parseListenersEnv() map[string]int {
+	var result = map[string]int{}
+
+	var raw = os.Getenv(listenersEnvVar)
+	if raw == "" {
+		return result
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		var i = strings.LastIndex(entry, "=")
+		if i < 0 {
+			continue
+		}
+
+		fd, err := strconv.Atoi(entry[i+1:])
+		if err != nil {
+			continue
+		}
+
+		result[entry[:i]] = fd
+	}
+
+	return result
+}
+
+// loadSystemdListeners parses the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES
+// environment variables set by systemd when this process was started through
+// socket activation. See sd_listen_fds(3) for the protocol
+func loadSystemdListeners() {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return
+	}
+
+	var names = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < n; i++ {
+		var fd = systemdFirstFD + i
+
+		var name string
+		if i < len(names) {
+			name = names[i]
+		}
+
+		var file = os.NewFile(uintptr(fd), fmt.Sprintf("systemd-socket-%d", fd))
+
+		if name != "" && name != "unknown" {
+			systemdNamed[name] = file
+		} else {
+			systemdUnnamed = append(systemdUnnamed, file)
+		}
+	}
+}
+
+// listenerExtraFiles returns the files backing all listeners registered
+// through Listen/ListenTCP/ListenUnix/ListenPacket, in a deterministic order,
+// along with the value to set the ZERODOWN_LISTENERS environment variable to
+// so the child process can look them back up. baseFD is the file descriptor
+// number the first returned file will end up on once appended to
+// cmd.ExtraFiles
+func listenerExtraFiles(baseFD int) (files []*os.File, env string) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	var keys = make([]string, 0, len(listeners))
+	for key := range listeners {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts = make([]string, 0, len(keys))
+	for i, key := range keys {
+		files = append(files, listeners[key])
+		parts = append(parts, fmt.Sprintf("%s=%d", key, baseFD+i))
+	}
+
+	return files, strings.Join(parts, ",")
+}
@@ -0,0 +1,131 @@
+package zerodown
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Readiness, when set, is polled after starting a new child process instead
+// of waiting for the child to call StartupFinished(). This is useful for
+// services that start accepting connections on their inherited socket before
+// they're actually ready to serve requests correctly, for example while a
+// database pool is still warming up or a cache is still loading
+var Readiness ReadinessProbe
+
+// ReadinessPollInterval is how often the parent process polls Readiness
+// while waiting for a new child process to become ready
+var ReadinessPollInterval = time.Millisecond * 250
+
+// ReadinessProbe is polled by the parent process, at ReadinessPollInterval,
+// to determine whether a newly started child process is ready to take over
+// from the previous one. It is polled until it reports ready or
+// StartupTimeout is reached, whichever comes first
+type ReadinessProbe interface {
+	// Ready reports whether the child process is ready to serve traffic
+	Ready() bool
+}
+
+// TCPProbe is a ReadinessProbe that considers the child ready as soon as it
+// accepts a TCP connection on Address
+type TCPProbe struct {
+	Address string
+
+	// Timeout for each connection attempt. Defaults to ReadinessPollInterval
+	// if zero
+	Timeout time.Duration
+}
+
+func (p TCPProbe) Ready() bool {
+	conn, err := net.DialTimeout("tcp", p.Address, probeTimeout(p.Timeout))
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+	return true
+}
+
+// UnixProbe is a ReadinessProbe that considers the child ready as soon as it
+// accepts a connection on the Unix domain socket at Address
+type UnixProbe struct {
+	Address string
+
+	// Timeout for each connection attempt. Defaults to ReadinessPollInterval
+	// if zero
+	Timeout time.Duration
+}
+
+func (p UnixProbe) Ready() bool {
+	conn, err := net.DialTimeout("unix", p.Address, probeTimeout(p.Timeout))
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+	return true
+}
+
+// HTTPProbe is a ReadinessProbe that considers the child ready once a GET
+// request to URL returns a 2xx status code
+type HTTPProbe struct {
+	URL string
+
+	// Client used to perform the request. Defaults to http.DefaultClient if
+	// nil. Set Client.Timeout if the default (no timeout) isn't appropriate
+	Client *http.Client
+}
+
+func (p HTTPProbe) Ready() bool {
+	var client = p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(p.URL)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+func probeTimeout(t time.Duration) time.Duration {
+	if t > 0 {
+		return t
+	}
+
+	return ReadinessPollInterval
+}
+
+// waitForChildReady polls Readiness until it reports the child ready, the
+// child crashes before becoming ready, or StartupTimeout is reached. It
+// returns true when Readiness reported ready and also when StartupTimeout was
+// reached; false means the child crashed before Readiness reported it ready
+func waitForChildReady(pid int) (ready bool) {
+	var ticker = time.NewTicker(ReadinessPollInterval)
+	defer ticker.Stop()
+
+	var timer = time.NewTimer(StartupTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if Readiness.Ready() {
+				print("Child process %d reported ready", pid)
+				return true
+			}
+		case <-timer.C:
+			print("Waiting for child process to become ready timed out")
+			emit(StartupTimedOut{PID: pid})
+			return true
+		case spid := <-stopped:
+			if pid == spid {
+				print("Child process %d has crashed before becoming ready!", pid)
+				return false
+			}
+		}
+	}
+}
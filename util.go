@@ -3,7 +3,9 @@ package zerodown
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
+	"time"
 )
 
 func IsParent() bool {
@@ -20,23 +22,41 @@ func IsChild() bool {
 }
 
 // Restart allows a child process to call for a restart. The parent process will
-// start a new child and will shut down the current process
+// start a new child and will shut down the current process. It blocks until
+// the parent acks the outcome (see RestartSucceededSignal/RestartFailedSignal),
+// so a RestartFailedSignal ack is reported as an error, not just a request
+// that couldn't be delivered. If no ack arrives within StartupTimeout it
+// returns a timeout error, whether or not the restart later succeeds
 func Restart() (err error) {
-	if parentPID != 0 {
-		print("Sending %s signal to parent PID %d", ReloadSignals[0], parentPID)
-
-		process, err := os.FindProcess(parentPID)
-		if err != nil {
-			return fmt.Errorf("could not find parent process: %w", err)
-		}
-		if err = process.Signal(ReloadSignals[0]); err != nil {
-			return fmt.Errorf("could not signal parent process: %w", err)
-		}
-	} else {
+	if parentPID == 0 {
 		panic("Restart should not be called on the parent process itself")
 	}
 
-	return nil
+	// Start listening for the parent's ack before we signal it, so we can't
+	// miss a reply that comes back very quickly
+	var ack = make(chan os.Signal, 2)
+	signal.Notify(ack, RestartSucceededSignal, RestartFailedSignal)
+	defer signal.Stop(ack)
+
+	print("Sending %s signal to parent PID %d", ReloadSignals[0], parentPID)
+
+	process, err := os.FindProcess(parentPID)
+	if err != nil {
+		return fmt.Errorf("could not find parent process: %w", err)
+	}
+	if err = process.Signal(ReloadSignals[0]); err != nil {
+		return fmt.Errorf("could not signal parent process: %w", err)
+	}
+
+	select {
+	case sig := <-ack:
+		if sig == RestartFailedSignal {
+			return fmt.Errorf("zerodown: parent failed to start a replacement child process")
+		}
+		return nil
+	case <-time.After(StartupTimeout):
+		return fmt.Errorf("zerodown: timed out waiting for parent to acknowledge restart")
+	}
 }
 
 func print(str string, args ...any) {
@@ -0,0 +1,141 @@
+// Package zdhttp ties the lifecycle of a net/http server into zerodown's
+// restart machinery, so a production HTTP service doesn't need to reimplement
+// connection draining itself.
+package zdhttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"fornaxian.tech/zerodown"
+)
+
+// DefaultDrainTimeout is used by Serve and ServeTLS when drainTimeout is
+// zero or negative
+const DefaultDrainTimeout = time.Second * 30
+
+// Serve runs server on listener until zerodown signals the child process to
+// stop (see zerodown.StopSignals). When that happens it stops accepting new
+// connections and calls server.Shutdown with a context bound to
+// drainTimeout, letting in-flight requests finish before returning. Serve
+// blocks until the server has fully shut down, so the child process can exit
+// cleanly as soon as it returns
+func Serve(server *http.Server, listener net.Listener, drainTimeout time.Duration) error {
+	return serve(server, listener, drainTimeout, false)
+}
+
+// ServeTLS is like Serve, but serves TLS connections. Configure the
+// certificate(s) through server.TLSConfig before calling ServeTLS
+func ServeTLS(server *http.Server, listener net.Listener, drainTimeout time.Duration) error {
+	return serve(server, listener, drainTimeout, true)
+}
+
+func serve(server *http.Server, listener net.Listener, drainTimeout time.Duration, useTLS bool) error {
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultDrainTimeout
+	}
+
+	if tcpListener, ok := listener.(*net.TCPListener); ok {
+		listener = tcpKeepAliveListener{tcpListener}
+	}
+
+	// Run the server in the background so we can wait for either a stop
+	// signal or the server exiting on its own (e.g. because the listener was
+	// closed from elsewhere)
+	var serveErr = make(chan error, 1)
+	go func() {
+		var err error
+		if useTLS {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		} else {
+			serveErr <- nil
+		}
+	}()
+
+	var signals = make(chan os.Signal, 1)
+	signal.Notify(signals, zerodown.StopSignals...)
+	defer signal.Stop(signals)
+
+	select {
+	case <-signals:
+	case err := <-serveErr:
+		// The server exited on its own before we ever got a stop signal
+		return err
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	return <-serveErr
+}
+
+// Entry pairs a server with the listener it should serve on, for use with
+// ServeAll
+type Entry struct {
+	Server   *http.Server
+	Listener net.Listener
+	TLS      bool
+}
+
+// ServeAll runs Serve (or ServeTLS, depending on Entry.TLS) for every entry
+// concurrently, and waits for all of them to finish draining before
+// returning. Use this when a single process serves multiple listeners (for
+// example a plain HTTP port and a separate metrics port) and the child
+// process should only exit once every one of them has shut down cleanly
+func ServeAll(drainTimeout time.Duration, entries ...Entry) error {
+	var wg sync.WaitGroup
+	var errs = make([]error, len(entries))
+
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry Entry) {
+			defer wg.Done()
+			errs[i] = serve(entry.Server, entry.Listener, drainTimeout, entry.TLS)
+		}(i, entry)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tcpKeepAliveListener wraps a *net.TCPListener and sets a keep-alive period
+// on every accepted connection, so connections left idle by misbehaving
+// clients eventually get closed instead of piling up forever. This mirrors
+// the unexported type of the same name that older versions of net/http used
+type tcpKeepAliveListener struct {
+	*net.TCPListener
+}
+
+func (ln tcpKeepAliveListener) Accept() (net.Conn, error) {
+	conn, err := ln.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetKeepAlive(true)
+	conn.SetKeepAlivePeriod(3 * time.Minute)
+
+	return conn, nil
+}
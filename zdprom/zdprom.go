@@ -0,0 +1,59 @@
+// Package zdprom registers a small set of standard Prometheus metrics and
+// keeps them updated from zerodown's lifecycle event stream, so restart
+// activity shows up on /metrics without users having to write their own
+// event handler.
+package zdprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"fornaxian.tech/zerodown"
+)
+
+var (
+	restartsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "zerodown_restarts_total",
+		Help: "Total number of times a new child process was promoted",
+	})
+
+	restartDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "zerodown_restart_duration_seconds",
+		Help: "Time between a child process being started and it reporting ready or reaching the startup timeout",
+	})
+
+	childCrashesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "zerodown_child_crashes_total",
+		Help: "Total number of times a child process exited unexpectedly",
+	})
+)
+
+// Register registers the zdprom metrics with reg and starts feeding them
+// from zerodown's event stream via zerodown.OnEvent. Call this once, in the
+// parent process before zerodown.Init(), since events are only emitted there
+func Register(reg prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{
+		restartsTotal,
+		restartDurationSeconds,
+		childCrashesTotal,
+	} {
+		if err := reg.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	zerodown.OnEvent(observe)
+
+	return nil
+}
+
+func observe(ev zerodown.Event) {
+	switch ev := ev.(type) {
+	case zerodown.ChildReady:
+		restartsTotal.Inc()
+		restartDurationSeconds.Observe(ev.Duration.Seconds())
+	case zerodown.ChildExited:
+		if !ev.Expected {
+			childCrashesTotal.Inc()
+		}
+	}
+}
@@ -38,11 +38,36 @@ var (
 	// and the child
 	StartupFinishedSignal = syscall.SIGUSR1
 
+	// Signals the parent process sends back to a child that called Restart(),
+	// to report whether the restart succeeded. These default to signals that
+	// the OS ignores by default, so a child that never calls Restart() (and
+	// therefore never registers a handler for them) is unaffected by receiving
+	// one. Make sure these are the same on both the parent and the child
+	RestartSucceededSignal os.Signal = syscall.SIGWINCH
+	RestartFailedSignal    os.Signal = syscall.SIGURG
+
 	// Extra file descriptors to pass to the child process
 	ExtraFiles []*os.File
 
 	// Extra environment variables to pass to the child process
 	ExtraVariables []string
+
+	// Maximum total number of times restart() tries to start a new child
+	// process if it keeps crashing before finishing initialization. Once
+	// this many attempts have failed restart() gives up and returns an
+	// error, leaving the previous (still healthy) child process running
+	MaxRestartAttempts = 3
+
+	// Base delay between restart attempts. The delay after attempt n
+	// (0-indexed) is RestartBackoff * 2^n
+	RestartBackoff = time.Second
+
+	// If a promoted child process exits within CrashLoopWindow of becoming
+	// ready more than CrashLoopThreshold times in a row, restart() stops
+	// retrying automatically and just reports the error instead of endlessly
+	// cycling through crashing processes
+	CrashLoopThreshold = 5
+	CrashLoopWindow    = time.Second * 10
 )
 
 // Initialize the zerodown parent process. This should be the very first thing
@@ -74,7 +99,7 @@ func Init() (exit bool) {
 	print("Parent process started with PID %d. Starting child and listening for signals...", os.Getpid())
 
 	// Start the child process
-	if err := restart(); err != nil {
+	if err := restart(nil); err != nil {
 		panic(fmt.Errorf("failed to start child process: %w", err))
 	}
 
@@ -82,12 +107,35 @@ func Init() (exit bool) {
 	signal.Notify(signals, combineSlices(ReloadSignals, StopSignals, PassthroughSignals)...)
 
 	for sig := range signals {
+		emit(SignalReceived{Signal: sig})
+
 		if inArray(sig, ReloadSignals) {
 			print("Reload signal caught! Restarting child process")
+			emit(RestartRequested{Source: "signal"})
+
+			// Remember who to ack, if anyone: childProcess is about to be
+			// reassigned to the new child process by restart()
+			var requester = childProcess
+
+			// If a ConfigLoader is registered we load and validate the config
+			// ourselves before forking a new child, so a broken config file
+			// aborts the reload instead of restarting into a child that's
+			// just going to fail to parse it
+			config, hasConfig, err := loadConfig()
+			if hasConfig && err != nil {
+				print("Config reload aborted: %s", err)
+				ackRestart(requester, err)
+				continue
+			}
 
-			if err := restart(); err != nil {
-				panic(fmt.Errorf("failed to start child process: %w", err))
+			// A failed restart keeps the previous child process running, so
+			// there's nothing to panic about here: just report the error and
+			// keep serving signals
+			err = restart(config)
+			if err != nil {
+				print("Failed to restart child process: %s", err)
 			}
+			ackRestart(requester, err)
 		} else if inArray(sig, StopSignals) {
 			print("Interrupt caught. Stopping child processes...")
 
@@ -148,9 +196,56 @@ var (
 	// The old process will be shut down once the new process has finished
 	// initialization
 	childProcess *os.Process
+
+	// crashLoopMu guards readyAt and crashLoopStreak
+	crashLoopMu sync.Mutex
+
+	// readyAt records when a given PID became ready, so that if it exits
+	// shortly afterwards we can tell a crash loop apart from a normal,
+	// long-running process finally shutting down
+	readyAt = map[int]time.Time{}
+
+	// expectedStop holds the PIDs of processes we deliberately asked to stop
+	// through stopChild, e.g. the previous process being retired after a
+	// successful handoff. checkCrashLoop ignores exits of these PIDs: they
+	// didn't crash, we told them to leave
+	expectedStop = map[int]bool{}
+
+	// Number of promoted child processes in a row that have crashed within
+	// CrashLoopWindow of becoming ready
+	crashLoopStreak = 0
+
+	// Set once CrashLoopThreshold is exceeded. restart() refuses to start any
+	// more child processes once this is set
+	crashLoopTripped = false
 )
 
-func restart() (err error) {
+// restart starts a new child process, retrying with exponential backoff if
+// the new process keeps crashing before it finishes initializing, up to a
+// total of MaxRestartAttempts attempts. On success the previous child
+// process is stopped. On failure the previous child process, if any, is
+// left running and an error is returned
+func restart(config any) (err error) {
+	for attempt := 0; ; attempt++ {
+		if err = attemptRestart(attempt, config); err == nil {
+			return nil
+		}
+
+		if attempt+1 >= MaxRestartAttempts {
+			return err
+		}
+
+		var backoff = RestartBackoff * time.Duration(1<<attempt)
+		print("Restart attempt %d failed: %s. Retrying in %s", attempt+1, err, backoff)
+		time.Sleep(backoff)
+	}
+}
+
+func attemptRestart(attempt int, config any) (err error) {
+	if crashLoopTripped {
+		return fmt.Errorf("zerodown: refusing to restart, child process is crash-looping")
+	}
+
 	executable, err := os.Executable()
 	if err != nil {
 		return fmt.Errorf("failed to get executable name: %w", err)
@@ -169,13 +264,38 @@ func restart() (err error) {
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.ExtraFiles = ExtraFiles
+
+	// Listeners opened through Listen/ListenTCP/ListenUnix/ListenPacket are
+	// appended after the user's own ExtraFiles, and described to the child
+	// process through the ZERODOWN_LISTENERS environment variable so it can
+	// find them again by network/address instead of a hard-coded FD number
+	listenerFiles, listenersEnv := listenerExtraFiles(firstExtraFD + len(ExtraFiles))
+	cmd.ExtraFiles = combineSlices(ExtraFiles, listenerFiles)
+	if listenersEnv != "" {
+		cmd.Env = append(cmd.Env, listenersEnvVar+"="+listenersEnv)
+	}
+
+	// If we have a freshly validated config to hand down, pass it through a
+	// pipe instead of letting the child re-read (and re-parse) it from disk,
+	// avoiding a TOCTOU where the file on disk changes between us validating
+	// it and the child loading it
+	if config != nil {
+		configFile, configEnv, err := configPipe(config, firstExtraFD+len(cmd.ExtraFiles))
+		if err != nil {
+			return fmt.Errorf("failed to pass config to child process: %w", err)
+		}
+
+		cmd.ExtraFiles = append(cmd.ExtraFiles, configFile)
+		cmd.Env = append(cmd.Env, configEnv)
+		defer configFile.Close()
+	}
 
 	if err = cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start child process: %w", err)
 	}
 
 	watchChild(cmd.Process)
+	emit(ChildStarted{PID: cmd.Process.Pid, Attempt: attempt + 1})
 
 	// Swap the processes
 	var oldProcess = childProcess
@@ -188,10 +308,21 @@ func restart() (err error) {
 		restartCounter, cmd.Process.Pid,
 	)
 
+	var startedAt = time.Now()
+
 	// Wait for the child process to initialize before giving the old process
 	// the order to shut down. This allows the old process to keep answering
 	// requests until the new process is ready to go
-	waitForChildInit(cmd.Process.Pid)
+	if ready := waitForChildInit(cmd.Process.Pid); !ready {
+		// The new process crashed before it finished initializing. Roll back
+		// to the previous process instead of stopping a perfectly healthy
+		// one, and report the failure so the caller can retry or alert
+		childProcess = oldProcess
+		return fmt.Errorf("new child process %d crashed before finishing initialization", cmd.Process.Pid)
+	}
+
+	emit(ChildReady{PID: cmd.Process.Pid, Duration: time.Since(startedAt)})
+	markReady(cmd.Process.Pid)
 
 	// Now that we know that the new process has finished initializing we can
 	// tell the previous process to shut down
@@ -200,6 +331,64 @@ func restart() (err error) {
 	return nil
 }
 
+// markReady records that pid became ready, so a later exit can be checked
+// against CrashLoopWindow by checkCrashLoop
+func markReady(pid int) {
+	crashLoopMu.Lock()
+	readyAt[pid] = time.Now()
+	crashLoopMu.Unlock()
+}
+
+// consumeExpectedStop reports whether pid was deliberately retired through
+// stopChild, clearing the bookkeeping either way so it doesn't leak
+func consumeExpectedStop(pid int) (expected bool) {
+	crashLoopMu.Lock()
+	defer crashLoopMu.Unlock()
+
+	expected = expectedStop[pid]
+	delete(expectedStop, pid)
+
+	return expected
+}
+
+// checkCrashLoop is called whenever a child process exits. If it exits
+// within CrashLoopWindow of becoming ready, that counts towards a crash
+// loop; otherwise the streak resets. Exits we asked for ourselves, through
+// stopChild, are ignored entirely: a process being retired after a
+// successful handoff is not a crash, no matter how quickly it happens. Once
+// the streak exceeds CrashLoopThreshold, restart() stops starting new child
+// processes altogether
+func checkCrashLoop(pid int, expected bool) {
+	crashLoopMu.Lock()
+	defer crashLoopMu.Unlock()
+
+	var since, wasReady = readyAt[pid]
+	delete(readyAt, pid)
+
+	if expected {
+		return
+	}
+
+	if !wasReady {
+		return
+	}
+
+	if time.Since(since) >= CrashLoopWindow {
+		crashLoopStreak = 0
+		return
+	}
+
+	crashLoopStreak++
+	if crashLoopStreak > CrashLoopThreshold {
+		crashLoopTripped = true
+		print(
+			"Child process %d crashed %d times in a row within %s of becoming "+
+				"ready. Giving up on automatic restarts.",
+			pid, crashLoopStreak, CrashLoopWindow,
+		)
+	}
+}
+
 // watchChild calls Wait on the child process so that the resources are properly
 // released when the process ends. If we don't do this the process will turn
 // into a zombie when it exits. The process is added to the shutdown waitgroup
@@ -214,7 +403,11 @@ func watchChild(child *os.Process) {
 			child.Pid, state, err,
 		)
 
+		var expected = consumeExpectedStop(child.Pid)
+		emit(ChildExited{PID: child.Pid, State: state, Err: err, Expected: expected})
+
 		shutdownWG.Done()
+		checkCrashLoop(child.Pid, expected)
 
 		// Send the PID through the stopped channel. If waitForChildInit is
 		// waiting this will tell it that the process has ended. This channel is
@@ -223,7 +416,18 @@ func watchChild(child *os.Process) {
 	}()
 }
 
-func waitForChildInit(pid int) {
+// waitForChildInit blocks until the child process signals that it's done
+// initializing (or a ReadinessProbe reports it ready), the child crashes
+// first, or StartupTimeout is reached. It reports whether the handoff to the
+// child should go ahead: true when the child is ready and also when
+// StartupTimeout was reached; false means the child crashed first
+func waitForChildInit(pid int) (ready bool) {
+	// If a ReadinessProbe is configured we poll it instead of waiting for the
+	// child to call StartupFinished()
+	if Readiness != nil {
+		return waitForChildReady(pid)
+	}
+
 	// Make a channel to start listening for SIGUSR1, the signal sent when the
 	// child process is done with initialization. When the signal is received,
 	// or a timeout is reached, we stop listening
@@ -238,24 +442,49 @@ func waitForChildInit(pid int) {
 		select {
 		case <-initChan:
 			print("Child init finished")
-			return
+			return true
 		case <-timer.C:
 			print("Waiting for child process timed out")
-			return
+			emit(StartupTimedOut{PID: pid})
+			return true
 		case spid := <-stopped:
 			if pid == spid {
 				print("Child process %d has crashed before initialization!", pid)
-				return
+				return false
 			}
 		}
 	}
 }
 
+// ackRestart reports the outcome of a reload back to requester, the child
+// process that was running when the reload signal was caught, if any. This
+// is what lets a blocking Restart() call in the child tell its caller
+// whether the restart actually succeeded, instead of just whether the
+// signal was delivered
+func ackRestart(requester *os.Process, err error) {
+	if requester == nil {
+		return
+	}
+
+	var sig = RestartSucceededSignal
+	if err != nil {
+		sig = RestartFailedSignal
+	}
+
+	if sigErr := requester.Signal(sig); sigErr != nil {
+		print("Failed to acknowledge restart to PID %d: %s", requester.Pid, sigErr)
+	}
+}
+
 func stopChild(child *os.Process) {
 	if child == nil {
 		return
 	}
 
+	crashLoopMu.Lock()
+	expectedStop[child.Pid] = true
+	crashLoopMu.Unlock()
+
 	print("Sending stop signal to child process with PID %d", child.Pid)
 
 	if err := child.Signal(StopSignals[0]); err != nil {